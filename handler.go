@@ -7,36 +7,52 @@
 package oauthclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/baozhenglab/sdkcm"
-	"github.com/parnurzeal/gorequest"
 )
 
 // Return Token object when login with username and password
 func (o *oauth) PasswordCredentialsToken(username, password string) (*Token, error) {
+	return o.PasswordCredentialsTokenWithContext(context.Background(), username, password)
+}
+
+// PasswordCredentialsTokenWithContext is the context-aware equivalent of
+// PasswordCredentialsToken.
+func (o *oauth) PasswordCredentialsTokenWithContext(ctx context.Context, username, password string) (*Token, error) {
 	var t TokenResponse
 
-	res, body, _ := gorequest.New().Post(o.clientConf.TokenURL).
-		SetBasicAuth(o.clientConf.ClientID, o.clientConf.ClientSecret).
-		SendString(url.Values{
-			"grant_type": {"password"},
-			"username":   {username},
-			"password":   {password},
-			"scope":      o.clientConf.Scopes,
-		}.Encode()).End()
+	body, statusCode, err := o.doGrantForm(ctx, o.clientConf.TokenURL, url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+		"scope":      o.clientConf.Scopes,
+	})
 
-	if err := json.Unmarshal([]byte(body), &t); err != nil {
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &t); err != nil {
 		return nil, sdkcm.ErrInvalidRequest(err)
 	}
 
-	if res.StatusCode != 200 {
-		return nil, sdkcm.NewAppErr(errors.New(t.Error), res.StatusCode, t.Error).WithCode("wrong_username_password")
+	if statusCode != http.StatusOK {
+		if t.Error == "mfa_required" {
+			var mfa struct {
+				ChallengeToken string `json:"challenge_token"`
+			}
+			if err := json.Unmarshal(body, &mfa); err == nil {
+				return nil, &ErrMFARequired{ChallengeToken: mfa.ChallengeToken}
+			}
+		}
+		return nil, sdkcm.NewAppErr(errors.New(t.Error), statusCode, t.Error).WithCode("wrong_username_password")
 	}
 
 	t.Token.HasUsernamePassword = true
@@ -45,14 +61,29 @@ func (o *oauth) PasswordCredentialsToken(username, password string) (*Token, err
 	return t.Token, nil
 }
 
-// Introspect return access token, refresh token, expired time and its data
-func (o *oauth) Introspect(token string) (*TokenIntrospect, error) {
+// Introspect returns the RFC 7662 introspection response for token: whether
+// it is active, its scope, client_id, username, exp, iat, sub, aud and iss.
+// tokenTypeHint is optional and should be one of "access_token" or
+// "refresh_token"; pass "" to omit it.
+func (o *oauth) Introspect(token, tokenTypeHint string) (*TokenIntrospect, error) {
+	return o.IntrospectWithContext(context.Background(), token, tokenTypeHint)
+}
+
+// IntrospectWithContext is the context-aware equivalent of Introspect.
+func (o *oauth) IntrospectWithContext(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospect, error) {
 	var ti TokenIntrospect
 
-	out, err := o.call(
-		strings.Replace(o.clientConf.TokenURL, "token", "introspect", -1),
-		url.Values{"token": []string{token}, "scope": []string{}},
-	)
+	payload := url.Values{"token": []string{token}, "scope": []string{}}
+	if tokenTypeHint != "" {
+		payload.Set("token_type_hint", tokenTypeHint)
+	}
+
+	introspectionURL := o.introspectionURL
+	if introspectionURL == "" {
+		introspectionURL = strings.Replace(o.clientConf.TokenURL, "token", "introspect", -1)
+	}
+
+	out, err := o.doForm(ctx, introspectionURL, payload)
 
 	if err != nil {
 		return nil, err
@@ -66,7 +97,12 @@ func (o *oauth) Introspect(token string) (*TokenIntrospect, error) {
 }
 
 func (o *oauth) FindUserById(uid string) (*OAuthUser, error) {
-	out, err := o.call(strings.Replace(
+	return o.FindUserByIdWithContext(context.Background(), uid)
+}
+
+// FindUserByIdWithContext is the context-aware equivalent of FindUserById.
+func (o *oauth) FindUserByIdWithContext(ctx context.Context, uid string) (*OAuthUser, error) {
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s", uid),
@@ -86,6 +122,11 @@ func (o *oauth) FindUserById(uid string) (*OAuthUser, error) {
 }
 
 func (o *oauth) FindUser(filter *OAuthUserFilter) (*OAuthUser, error) {
+	return o.FindUserWithContext(context.Background(), filter)
+}
+
+// FindUserWithContext is the context-aware equivalent of FindUser.
+func (o *oauth) FindUserWithContext(ctx context.Context, filter *OAuthUserFilter) (*OAuthUser, error) {
 	payload := url.Values{}
 
 	if v := filter.Username; v != nil {
@@ -108,7 +149,7 @@ func (o *oauth) FindUser(filter *OAuthUserFilter) (*OAuthUser, error) {
 		payload.Add("phone_prefix", *v)
 	}
 
-	out, err := o.call(strings.Replace(
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("find-user"),
@@ -132,6 +173,11 @@ func (o *oauth) FindUser(filter *OAuthUserFilter) (*OAuthUser, error) {
 }
 
 func (o *oauth) CreateUser(user *OAuthUserCreate) (*Token, error) {
+	return o.CreateUserWithContext(context.Background(), user)
+}
+
+// CreateUserWithContext is the context-aware equivalent of CreateUser.
+func (o *oauth) CreateUserWithContext(ctx context.Context, user *OAuthUserCreate) (*Token, error) {
 	var t Token
 
 	payload := url.Values{}
@@ -159,7 +205,7 @@ func (o *oauth) CreateUser(user *OAuthUserCreate) (*Token, error) {
 		payload.Add("client_id", *user.ClientId)
 	}
 
-	out, err := o.call(strings.Replace(
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		"users",
@@ -178,9 +224,15 @@ func (o *oauth) CreateUser(user *OAuthUserCreate) (*Token, error) {
 }
 
 func (o *oauth) CreateUserWithEmail(email string) (*Token, error) {
+	return o.CreateUserWithEmailWithContext(context.Background(), email)
+}
+
+// CreateUserWithEmailWithContext is the context-aware equivalent of
+// CreateUserWithEmail.
+func (o *oauth) CreateUserWithEmailWithContext(ctx context.Context, email string) (*Token, error) {
 	var t Token
 
-	out, err := o.call(strings.Replace(
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		"users?type=gmail",
@@ -201,9 +253,15 @@ func (o *oauth) CreateUserWithEmail(email string) (*Token, error) {
 }
 
 func (o *oauth) CreateUserWithFacebook(fbId, email string) (*Token, error) {
+	return o.CreateUserWithFacebookWithContext(context.Background(), fbId, email)
+}
+
+// CreateUserWithFacebookWithContext is the context-aware equivalent of
+// CreateUserWithFacebook.
+func (o *oauth) CreateUserWithFacebookWithContext(ctx context.Context, fbId, email string) (*Token, error) {
 	var t Token
 
-	out, err := o.call(strings.Replace(
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		"users?type=facebook",
@@ -225,9 +283,15 @@ func (o *oauth) CreateUserWithFacebook(fbId, email string) (*Token, error) {
 }
 
 func (o *oauth) CreateUserWithAccountKit(akId, email, prefix, phone string) (*Token, error) {
+	return o.CreateUserWithAccountKitWithContext(context.Background(), akId, email, prefix, phone)
+}
+
+// CreateUserWithAccountKitWithContext is the context-aware equivalent of
+// CreateUserWithAccountKit.
+func (o *oauth) CreateUserWithAccountKitWithContext(ctx context.Context, akId, email, prefix, phone string) (*Token, error) {
 	var t Token
 
-	out, err := o.call(strings.Replace(
+	out, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		"users?type=account-kit",
@@ -251,6 +315,11 @@ func (o *oauth) CreateUserWithAccountKit(akId, email, prefix, phone string) (*To
 }
 
 func (o *oauth) UpdateUser(uid string, update *OAuthUserUpdate) error {
+	return o.UpdateUserWithContext(context.Background(), uid, update)
+}
+
+// UpdateUserWithContext is the context-aware equivalent of UpdateUser.
+func (o *oauth) UpdateUserWithContext(ctx context.Context, uid string, update *OAuthUserUpdate) error {
 	payload := url.Values{
 		"user_id": {uid},
 	}
@@ -301,7 +370,7 @@ func (o *oauth) UpdateUser(uid string, update *OAuthUserUpdate) error {
 		payload.Add("account_type", string(*update.AccountType))
 	}
 
-	_, err := o.call(strings.Replace(
+	_, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s/update", uid),
@@ -316,7 +385,13 @@ func (o *oauth) UpdateUser(uid string, update *OAuthUserUpdate) error {
 }
 
 func (o *oauth) ChangePassword(userId, oldPass, newPass string) error {
-	_, err := o.call(strings.Replace(
+	return o.ChangePasswordWithContext(context.Background(), userId, oldPass, newPass)
+}
+
+// ChangePasswordWithContext is the context-aware equivalent of
+// ChangePassword.
+func (o *oauth) ChangePasswordWithContext(ctx context.Context, userId, oldPass, newPass string) error {
+	_, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s/change-password", userId),
@@ -334,7 +409,13 @@ func (o *oauth) ChangePassword(userId, oldPass, newPass string) error {
 }
 
 func (o *oauth) SetUsernamePassword(userId, username, password string) error {
-	_, err := o.call(strings.Replace(
+	return o.SetUsernamePasswordWithContext(context.Background(), userId, username, password)
+}
+
+// SetUsernamePasswordWithContext is the context-aware equivalent of
+// SetUsernamePassword.
+func (o *oauth) SetUsernamePasswordWithContext(ctx context.Context, userId, username, password string) error {
+	_, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s/set-username-password", userId),
@@ -351,34 +432,73 @@ func (o *oauth) SetUsernamePassword(userId, username, password string) error {
 	return nil
 }
 
-func (o *oauth) RevokeToken(token string) error {
-	return nil
+// RevokeToken revokes token per RFC 7009, authenticating with the client's
+// own credentials. hint is optional and should be one of "access_token" or
+// "refresh_token". A 400 unsupported_token_type response is treated as
+// success, per the RFC: the server has nothing left to revoke.
+func (o *oauth) RevokeToken(ctx context.Context, token, hint string) error {
+	payload := url.Values{"token": {token}}
+	if hint != "" {
+		payload.Set("token_type_hint", hint)
+	}
+
+	body, statusCode, err := o.doGrantForm(ctx, o.revokeURL, payload)
+	if err != nil {
+		return err
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	var appErr sdkcm.AppError
+	if err := json.Unmarshal(body, &appErr); err != nil {
+		return err
+	}
+
+	if statusCode == http.StatusBadRequest && appErr.Code == "unsupported_token_type" {
+		return nil
+	}
+
+	return appErr
 }
 
 func (o *oauth) RefreshToken(refreshToken string) (*Token, error) {
+	return o.RefreshTokenWithContext(context.Background(), refreshToken)
+}
+
+// RefreshTokenWithContext is the context-aware equivalent of RefreshToken.
+func (o *oauth) RefreshTokenWithContext(ctx context.Context, refreshToken string) (*Token, error) {
 	var t TokenResponse
 
-	res, body, _ := gorequest.New().Post(o.clientConf.TokenURL).
-		SetBasicAuth(o.clientConf.ClientID, o.clientConf.ClientSecret).
-		SendString(url.Values{
-			"grant_type":    {"refresh_token"},
-			"refresh_token": {refreshToken},
-			"scope":         o.clientConf.Scopes,
-		}.Encode()).End()
+	body, statusCode, err := o.doGrantForm(ctx, o.clientConf.TokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         o.clientConf.Scopes,
+	})
 
-	if err := json.Unmarshal([]byte(body), &t); err != nil {
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &t); err != nil {
 		return nil, sdkcm.ErrInvalidRequest(err)
 	}
 
-	if res.StatusCode != 200 {
-		return nil, sdkcm.NewAppErr(errors.New(t.Error), res.StatusCode, t.Error)
+	if statusCode != http.StatusOK {
+		return nil, sdkcm.NewAppErr(errors.New(t.Error), statusCode, t.Error)
 	}
 
 	return t.Token, nil
 }
 
 func (o *oauth) DeleteUser(userId string) error {
-	_, err := o.call(strings.Replace(
+	return o.DeleteUserWithContext(context.Background(), userId)
+}
+
+// DeleteUserWithContext is the context-aware equivalent of DeleteUser.
+func (o *oauth) DeleteUserWithContext(ctx context.Context, userId string) error {
+	_, err := o.doForm(ctx, strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s", userId),
@@ -393,7 +513,7 @@ func (o *oauth) DeleteUser(userId string) error {
 }
 
 func (o *oauth) GetUser(userId string) error {
-	_, err := o.call(strings.Replace(
+	_, err := o.doForm(context.Background(), strings.Replace(
 		o.clientConf.TokenURL,
 		"token",
 		fmt.Sprintf("users/%s", userId),
@@ -406,25 +526,3 @@ func (o *oauth) GetUser(userId string) error {
 
 	return nil
 }
-
-func (o *oauth) call(url string, params url.Values) ([]byte, error) {
-	resp, err := o.client.PostForm(url, params)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	out, _ := ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode >= 300 {
-		var appErr sdkcm.AppError
-		if err := json.Unmarshal(out, &appErr); err != nil {
-			return nil, err
-		}
-
-		return nil, appErr
-	}
-
-	return out, nil
-}
@@ -0,0 +1,69 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRevokeTokenSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.revokeURL = server.URL
+
+	if err := o.RevokeToken(context.Background(), "tok", ""); err != nil {
+		t.Fatalf("RevokeToken returned error: %v", err)
+	}
+}
+
+func TestRevokeTokenUnsupportedTokenTypeIsTreatedAsSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"unsupported_token_type"}`))
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.revokeURL = server.URL
+
+	if err := o.RevokeToken(context.Background(), "tok", "refresh_token"); err != nil {
+		t.Fatalf("RevokeToken returned error for unsupported_token_type: %v", err)
+	}
+}
+
+func TestRevokeTokenPropagatesOtherErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"invalid_token"}`))
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.revokeURL = server.URL
+
+	if err := o.RevokeToken(context.Background(), "tok", ""); err == nil {
+		t.Fatalf("expected RevokeToken to return an error for an unrecognised failure code")
+	}
+}
+
+func TestRevokeTokenPropagatesNetworkFailureAfterRetries(t *testing.T) {
+	o := newTestClient()
+	o.revokeURL = "http://127.0.0.1:0" // nothing listens here
+	o.retryMaxAttemptsOverride = 2
+	o.requestTimeoutOverride = 250_000_000 // 250ms, keep the test fast
+
+	if err := o.RevokeToken(context.Background(), "tok", ""); err == nil {
+		t.Fatalf("expected RevokeToken to return an error when the revoke endpoint is unreachable")
+	}
+}
@@ -0,0 +1,23 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+// TokenIntrospect is the RFC 7662 introspection response: whether token is
+// active, its scope, client_id, username, exp, iat, sub, aud and iss.
+type TokenIntrospect struct {
+	Active   bool   `json:"active"`
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	Exp      int64  `json:"exp"`
+	Iat      int64  `json:"iat"`
+	Sub      string `json:"sub"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	UserID   string `json:"user_id"`
+	Aud      string `json:"aud"`
+	Iss      string `json:"iss"`
+}
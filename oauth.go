@@ -12,12 +12,17 @@ import (
 	"fmt"
 	"golang.org/x/oauth2/clientcredentials"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type TrustedClient interface {
 	PasswordCredentialsToken(username, password string) (*Token, error)
-	Introspect(token string) (*TokenIntrospect, error)
+	Introspect(token, tokenTypeHint string) (*TokenIntrospect, error)
 	RefreshToken(refreshToken string) (*Token, error)
+	// RevokeToken revokes an access or refresh token per RFC 7009. hint is
+	// optional and should be one of "access_token" or "refresh_token".
+	RevokeToken(ctx context.Context, token, hint string) error
 	FindUserById(uid string) (*OAuthUser, error)
 	FindUser(filter *OAuthUserFilter) (*OAuthUser, error)
 	CreateUser(user *OAuthUserCreate) (*Token, error)
@@ -28,18 +33,84 @@ type TrustedClient interface {
 	ChangePassword(userId, oldPass, newPass string) error
 	SetUsernamePassword(userId, username, password string) error
 	DeleteUser(userId string) error
+
+	// The WithContext variants below carry the same behaviour as their
+	// context.Background() counterparts above, but let callers cancel or
+	// time out the underlying HTTP round trip. The non-context methods are
+	// kept as thin wrappers for one release for backward compatibility and
+	// will be removed once callers have migrated.
+	PasswordCredentialsTokenWithContext(ctx context.Context, username, password string) (*Token, error)
+	IntrospectWithContext(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospect, error)
+	RefreshTokenWithContext(ctx context.Context, refreshToken string) (*Token, error)
+	FindUserByIdWithContext(ctx context.Context, uid string) (*OAuthUser, error)
+	FindUserWithContext(ctx context.Context, filter *OAuthUserFilter) (*OAuthUser, error)
+	CreateUserWithContext(ctx context.Context, user *OAuthUserCreate) (*Token, error)
+	UpdateUserWithContext(ctx context.Context, uid string, update *OAuthUserUpdate) error
+	CreateUserWithEmailWithContext(ctx context.Context, email string) (*Token, error)
+	CreateUserWithFacebookWithContext(ctx context.Context, fbId, email string) (*Token, error)
+	CreateUserWithAccountKitWithContext(ctx context.Context, akId, email, prefix, phone string) (*Token, error)
+	ChangePasswordWithContext(ctx context.Context, userId, oldPass, newPass string) error
+	SetUsernamePasswordWithContext(ctx context.Context, userId, username, password string) error
+	DeleteUserWithContext(ctx context.Context, userId string) error
+
+	// AuthCodeURL builds the authorize URL for the Authorization Code flow with
+	// PKCE (RFC 7636) and returns it together with the code_verifier generated
+	// for the given state. The verifier is also stashed in the client's
+	// PKCEStore, keyed by state, so ExchangeCode can load (and remove) it
+	// again once the redirect comes back.
+	AuthCodeURL(state string, opts ...AuthCodeOption) (authURL string, verifier string, err error)
+	// ExchangeCode completes the Authorization Code flow: it looks up the
+	// verifier AuthCodeURL stored for state, removes it from the PKCEStore so
+	// it can't be replayed, and exchanges code and that verifier for a token.
+	ExchangeCode(ctx context.Context, code, state, redirectURI string) (*Token, error)
+
+	// UserInfo calls the OIDC UserInfo endpoint with accessToken and maps the
+	// standard claims (sub, name, email, email_verified, phone_number,
+	// picture) into an OIDCUserInfo.
+	UserInfo(ctx context.Context, accessToken string) (*OIDCUserInfo, error)
+	// VerifyIDToken validates rawIDToken's signature against the provider's
+	// JWKS and checks iss, aud and exp, returning the parsed claims.
+	VerifyIDToken(ctx context.Context, rawIDToken string) (*IDTokenClaims, error)
+
+	// EnrollTOTP starts TOTP enrollment for userId, returning the shared
+	// secret, otpauth:// URI and a QR code PNG encoding that URI.
+	EnrollTOTP(ctx context.Context, userId string) (*TOTPEnrollment, error)
+	// ConfirmTOTP verifies the first code generated after enrollment and
+	// activates TOTP for userId, returning one-time recovery codes.
+	ConfirmTOTP(ctx context.Context, userId, code string) (recoveryCodes []string, err error)
+	// VerifyTOTP checks a step-up TOTP code for an already-enrolled userId.
+	VerifyTOTP(ctx context.Context, userId, code string) error
+	// DisableTOTP turns TOTP off for userId, confirming with a current code.
+	DisableTOTP(ctx context.Context, userId, code string) error
+	// PasswordCredentialsTokenWithOTP completes a PasswordCredentialsToken
+	// flow that returned ErrMFARequired by posting the challenge token and
+	// OTP the user just entered.
+	PasswordCredentialsTokenWithOTP(ctx context.Context, challengeToken, otp string) (*Token, error)
 }
 
 type oauth struct {
 	name       string
 	clientConf clientcredentials.Config
 	client     *http.Client
+
+	authURL          string
+	revokeURL        string
+	userInfoURL      string
+	jwksURL          string
+	introspectionURL string
+	pkceStore        PKCEStore
+	provider         *Provider
+
+	requestTimeoutOverride   time.Duration
+	retryMaxAttemptsOverride int
+	middlewares              []RoundTripperMiddleware
 }
 
 func New(name string, clientConf clientcredentials.Config) *oauth {
 	return &oauth{
 		name:       name,
 		clientConf: clientConf,
+		pkceStore:  NewInMemoryPKCEStore(),
 	}
 }
 
@@ -48,10 +119,20 @@ func (o *oauth) Name() string {
 }
 
 func (o *oauth) InitFlags() {
-	prefix := fmt.Sprintf("%s-", o.Name())
+	o.initFlagsWithPrefix(fmt.Sprintf("%s-", o.Name()))
+}
+
+// initFlagsWithPrefix registers every flag this client understands under
+// prefix. It backs both InitFlags (prefix "<name>-") and Registry.InitFlags
+// (prefix "oauth.<name>.") so the two configuration paths can't drift apart.
+func (o *oauth) initFlagsWithPrefix(prefix string) {
 	flag.StringVar(&o.clientConf.ClientSecret, prefix+"client-secret", o.clientConf.ClientSecret, "oauth client secret")
 	flag.StringVar(&o.clientConf.ClientID, prefix+"client-id", o.clientConf.ClientID, "oauth client id")
 	flag.StringVar(&o.clientConf.TokenURL, prefix+"token-url", o.clientConf.TokenURL, "oauth token url")
+	flag.StringVar(&o.authURL, prefix+"auth-url", o.authURL, "oauth authorize url")
+	flag.StringVar(&o.revokeURL, prefix+"revoke-url", o.revokeURL, "oauth revoke url")
+	flag.DurationVar(&o.requestTimeoutOverride, prefix+"request-timeout", o.requestTimeoutOverride, "oauth request timeout (default 10s)")
+	flag.IntVar(&o.retryMaxAttemptsOverride, prefix+"retry-max-attempts", o.retryMaxAttemptsOverride, "oauth max request attempts for 5xx/network errors (default 1, no retry)")
 }
 
 func (o *oauth) Configure() error {
@@ -59,7 +140,16 @@ func (o *oauth) Configure() error {
 		return nil
 	}
 
+	if o.authURL == "" {
+		o.authURL = strings.Replace(o.clientConf.TokenURL, "token", "authorize", -1)
+	}
+
+	if o.revokeURL == "" {
+		o.revokeURL = strings.Replace(o.clientConf.TokenURL, "token", "revoke", -1)
+	}
+
 	o.client = o.clientConf.Client(context.Background())
+	o.client.Transport = o.buildTransport(o.client.Transport)
 	return nil
 }
 
@@ -0,0 +1,157 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// newOIDCTestServer serves a minimal discovery document and JWKS so
+// NewProviderFromDiscovery and VerifyIDToken can be exercised against a real
+// (signature-checking) verifier instead of a mock.
+func newOIDCTestServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	jwk := jose.JSONWebKey{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"}
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}}
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+			"jwks_uri":               server.URL + "/jwks",
+			"introspection_endpoint": server.URL + "/introspect",
+			"revocation_endpoint":    server.URL + "/revoke",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	})
+
+	t.Cleanup(server.Close)
+	return server
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "test-key"))
+	if err != nil {
+		t.Fatalf("jose.NewSigner: %v", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("json.Marshal(claims): %v", err)
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("signer.Sign: %v", err)
+	}
+
+	raw, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("jws.CompactSerialize: %v", err)
+	}
+
+	return raw
+}
+
+func TestNewProviderFromDiscoveryAndVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+
+	server := newOIDCTestServer(t, key)
+
+	provider, err := NewProviderFromDiscovery(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("NewProviderFromDiscovery: %v", err)
+	}
+
+	if provider.JWKSURL != server.URL+"/jwks" {
+		t.Fatalf("provider.JWKSURL = %q, want %q", provider.JWKSURL, server.URL+"/jwks")
+	}
+	if provider.IntrospectionURL != server.URL+"/introspect" {
+		t.Fatalf("provider.IntrospectionURL = %q, want %q", provider.IntrospectionURL, server.URL+"/introspect")
+	}
+
+	o := New("test", clientcredentials.Config{ClientID: "client-id", ClientSecret: "client-secret"})
+	o.UseProvider(provider)
+
+	now := time.Now()
+	goodToken := signIDToken(t, key, map[string]interface{}{
+		"iss": server.URL,
+		"sub": "user-1",
+		"aud": "client-id",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	})
+
+	claims, err := o.VerifyIDToken(context.Background(), goodToken)
+	if err != nil {
+		t.Fatalf("VerifyIDToken(good token) returned error: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Issuer != server.URL || claims.Audience != "client-id" {
+		t.Fatalf("VerifyIDToken(good token) = %+v, want sub=user-1 iss=%s aud=client-id", claims, server.URL)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	tamperedToken := signIDToken(t, otherKey, map[string]interface{}{
+		"iss": server.URL,
+		"sub": "user-1",
+		"aud": "client-id",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	})
+	if _, err := o.VerifyIDToken(context.Background(), tamperedToken); err == nil {
+		t.Fatalf("VerifyIDToken accepted a token signed by a key absent from the JWKS")
+	}
+
+	expiredToken := signIDToken(t, key, map[string]interface{}{
+		"iss": server.URL,
+		"sub": "user-1",
+		"aud": "client-id",
+		"exp": now.Add(-time.Hour).Unix(),
+		"iat": now.Add(-2 * time.Hour).Unix(),
+	})
+	if _, err := o.VerifyIDToken(context.Background(), expiredToken); err == nil {
+		t.Fatalf("VerifyIDToken accepted an expired token")
+	}
+
+	wrongAudienceToken := signIDToken(t, key, map[string]interface{}{
+		"iss": server.URL,
+		"sub": "user-1",
+		"aud": "some-other-client",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	})
+	if _, err := o.VerifyIDToken(context.Background(), wrongAudienceToken); err == nil {
+		t.Fatalf("VerifyIDToken accepted a token issued for a different audience")
+	}
+}
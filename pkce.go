@@ -0,0 +1,166 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/baozhenglab/sdkcm"
+)
+
+// codeVerifierBytes is the amount of random bytes used to build the
+// code_verifier. Base64url-encoding 32 bytes yields a 43 char string, the
+// minimum length allowed by RFC 7636.
+const codeVerifierBytes = 32
+
+// AuthCodeOption lets callers add extra query params to the authorize URL
+// built by AuthCodeURL (e.g. scope, audience, prompt).
+type AuthCodeOption func(url.Values)
+
+// WithScope sets the scope param on the authorize URL.
+func WithScope(scope string) AuthCodeOption {
+	return func(v url.Values) {
+		v.Set("scope", scope)
+	}
+}
+
+// WithParam sets an arbitrary query param on the authorize URL.
+func WithParam(key, value string) AuthCodeOption {
+	return func(v url.Values) {
+		v.Set(key, value)
+	}
+}
+
+// PKCEStore persists the code_verifier generated for a given state so it can
+// be looked up again once the authorization server redirects back with a
+// code. Implementations must be safe for concurrent use.
+type PKCEStore interface {
+	Save(state, verifier string) error
+	Load(state string) (verifier string, ok bool)
+	Delete(state string)
+}
+
+type inMemoryPKCEStore struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+// NewInMemoryPKCEStore returns a PKCEStore backed by a plain in-process map.
+// It is the default used by New and is good enough for a single instance;
+// multi-instance deployments should supply their own PKCEStore (backed by
+// redis or similar) so a redirect can land on any node.
+func NewInMemoryPKCEStore() PKCEStore {
+	return &inMemoryPKCEStore{items: map[string]string{}}
+}
+
+func (s *inMemoryPKCEStore) Save(state, verifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[state] = verifier
+	return nil
+}
+
+func (s *inMemoryPKCEStore) Load(state string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	verifier, ok := s.items[state]
+	return verifier, ok
+}
+
+func (s *inMemoryPKCEStore) Delete(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, state)
+}
+
+// newCodeVerifier generates a cryptographically random code_verifier as
+// described by RFC 7636 section 4.1.
+func newCodeVerifier() (string, error) {
+	b := make([]byte, codeVerifierBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallengeS256 derives the S256 code_challenge for a given verifier.
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL builds the authorize URL for the Authorization Code flow with
+// PKCE (RFC 7636) and returns it together with the code_verifier generated
+// for the given state. The verifier is also stashed in the client's
+// PKCEStore, keyed by state, so ExchangeCode can look it up after the
+// redirect comes back.
+func (o *oauth) AuthCodeURL(state string, opts ...AuthCodeOption) (string, string, error) {
+	verifier, err := newCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := o.pkceStore.Save(state, verifier); err != nil {
+		return "", "", err
+	}
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.clientConf.ClientID},
+		"state":                 {state},
+		"code_challenge":        {codeChallengeS256(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return o.authURL + "?" + v.Encode(), verifier, nil
+}
+
+// ExchangeCode completes the Authorization Code flow: it looks up the
+// verifier AuthCodeURL stashed for state, removes it from the PKCEStore so
+// it can't be replayed, and exchanges code and that verifier for a token.
+func (o *oauth) ExchangeCode(ctx context.Context, code, state, redirectURI string) (*Token, error) {
+	verifier, ok := o.pkceStore.Load(state)
+	if !ok {
+		return nil, sdkcm.NewAppErr(errors.New("unknown or expired state"), http.StatusBadRequest, "invalid_state").WithCode("invalid_state")
+	}
+	o.pkceStore.Delete(state)
+
+	var t TokenResponse
+
+	body, statusCode, err := o.doGrantForm(ctx, o.clientConf.TokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, sdkcm.ErrInvalidRequest(err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, sdkcm.NewAppErr(errors.New(t.Error), statusCode, t.Error).WithCode("invalid_grant")
+	}
+
+	return t.Token, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+func TestCodeChallengeS256(t *testing.T) {
+	// Known-good vector from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	got := codeChallengeS256(verifier)
+	if got != want {
+		t.Fatalf("codeChallengeS256(%q) = %q, want %q", verifier, got, want)
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != got {
+		t.Fatalf("codeChallengeS256 does not match base64url(sha256(verifier))")
+	}
+}
+
+func TestNewCodeVerifierLength(t *testing.T) {
+	verifier, err := newCodeVerifier()
+	if err != nil {
+		t.Fatalf("newCodeVerifier() returned error: %v", err)
+	}
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Fatalf("verifier length %d out of RFC 7636 range [43, 128]", len(verifier))
+	}
+}
+
+func TestInMemoryPKCEStoreSaveLoadDelete(t *testing.T) {
+	store := NewInMemoryPKCEStore()
+
+	if _, ok := store.Load("missing"); ok {
+		t.Fatalf("expected Load for unknown state to report ok=false")
+	}
+
+	if err := store.Save("state-1", "verifier-1"); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	verifier, ok := store.Load("state-1")
+	if !ok || verifier != "verifier-1" {
+		t.Fatalf("Load(%q) = (%q, %v), want (%q, true)", "state-1", verifier, ok, "verifier-1")
+	}
+
+	store.Delete("state-1")
+	if _, ok := store.Load("state-1"); ok {
+		t.Fatalf("expected state to be gone after Delete")
+	}
+}
+
+func TestAuthCodeURLStoresVerifierByState(t *testing.T) {
+	o := New("test", clientcredentials.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		TokenURL:     "https://auth.example.com/token",
+	})
+	o.authURL = "https://auth.example.com/authorize"
+
+	authURL, verifier, err := o.AuthCodeURL("xyz", WithScope("profile"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned error: %v", err)
+	}
+
+	if authURL == "" || verifier == "" {
+		t.Fatalf("AuthCodeURL returned empty authURL or verifier")
+	}
+
+	stored, ok := o.pkceStore.Load("xyz")
+	if !ok || stored != verifier {
+		t.Fatalf("pkceStore.Load(%q) = (%q, %v), want (%q, true)", "xyz", stored, ok, verifier)
+	}
+}
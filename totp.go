@@ -0,0 +1,133 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/baozhenglab/sdkcm"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// TOTPEnrollment is returned by EnrollTOTP: the shared secret and otpauth://
+// URI a user can add to an authenticator app, plus a ready-to-display QR
+// code encoding that URI.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_url"`
+	QRCode     []byte `json:"-"`
+}
+
+// ErrMFARequired is returned by PasswordCredentialsToken when the server
+// answers with an mfa_required error. Callers prompt the user for their OTP
+// and complete the flow with PasswordCredentialsTokenWithOTP.
+type ErrMFARequired struct {
+	ChallengeToken string
+}
+
+func (e *ErrMFARequired) Error() string {
+	return "oauthclient: mfa required"
+}
+
+func (o *oauth) totpURL(userId, action string) string {
+	path := fmt.Sprintf("users/%s/totp", userId)
+	if action != "" {
+		path = path + "/" + action
+	}
+	return strings.Replace(o.clientConf.TokenURL, "token", path, -1)
+}
+
+// EnrollTOTP starts TOTP enrollment for userId, returning the shared secret,
+// otpauth:// URI and a QR code PNG encoding that URI for the user to scan.
+func (o *oauth) EnrollTOTP(ctx context.Context, userId string) (*TOTPEnrollment, error) {
+	out, err := o.doForm(ctx, o.totpURL(userId, ""), url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollment TOTPEnrollment
+	if err := json.Unmarshal(out, &enrollment); err != nil {
+		return nil, err
+	}
+
+	png, err := qrcode.Encode(enrollment.OTPAuthURI, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	enrollment.QRCode = png
+
+	return &enrollment, nil
+}
+
+// ConfirmTOTP verifies the first code generated after enrollment and
+// activates TOTP for userId, returning one-time recovery codes.
+func (o *oauth) ConfirmTOTP(ctx context.Context, userId, code string) ([]string, error) {
+	out, err := o.doForm(ctx, o.totpURL(userId, "confirm"), url.Values{
+		"code": {code},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(out, &confirmation); err != nil {
+		return nil, err
+	}
+
+	return confirmation.RecoveryCodes, nil
+}
+
+// VerifyTOTP checks a step-up TOTP code for an already-enrolled userId.
+func (o *oauth) VerifyTOTP(ctx context.Context, userId, code string) error {
+	_, err := o.doForm(ctx, o.totpURL(userId, "verify"), url.Values{
+		"code": {code},
+	})
+	return err
+}
+
+// DisableTOTP turns TOTP off for userId, confirming with a current code.
+func (o *oauth) DisableTOTP(ctx context.Context, userId, code string) error {
+	_, err := o.doForm(ctx, o.totpURL(userId, "disable"), url.Values{
+		"code": {code},
+	})
+	return err
+}
+
+// PasswordCredentialsTokenWithOTP completes a PasswordCredentialsToken flow
+// that returned ErrMFARequired by posting the challenge token and OTP the
+// user just entered.
+func (o *oauth) PasswordCredentialsTokenWithOTP(ctx context.Context, challengeToken, otp string) (*Token, error) {
+	var t TokenResponse
+
+	body, statusCode, err := o.doGrantForm(ctx, o.clientConf.TokenURL, url.Values{
+		"grant_type":      {"password_mfa"},
+		"challenge_token": {challengeToken},
+		"otp":             {otp},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, sdkcm.ErrInvalidRequest(err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, sdkcm.NewAppErr(errors.New(t.Error), statusCode, t.Error).WithCode("wrong_otp")
+	}
+
+	return t.Token, nil
+}
@@ -0,0 +1,218 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baozhenglab/sdkcm"
+)
+
+// RoundTripperMiddleware wraps an http.RoundTripper so callers can plug in
+// tracing (OpenTelemetry), Prometheus metrics or structured logging around
+// every request this client makes.
+type RoundTripperMiddleware func(next http.RoundTripper) http.RoundTripper
+
+const (
+	defaultRequestTimeout   = 10 * time.Second
+	defaultRetryMaxAttempts = 1 // no retry by default, preserves prior behaviour
+	retryBaseDelay          = 100 * time.Millisecond
+)
+
+var errTooManyRequests = errors.New("oauthclient: rate limited")
+
+// Use appends middleware to the client's RoundTripper chain. Call it before
+// Configure/Run, which is where the chain is applied to the underlying
+// *http.Client.
+func (o *oauth) Use(mw ...RoundTripperMiddleware) {
+	o.middlewares = append(o.middlewares, mw...)
+}
+
+func (o *oauth) buildTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := base
+	for i := len(o.middlewares) - 1; i >= 0; i-- {
+		rt = o.middlewares[i](rt)
+	}
+	return rt
+}
+
+func (o *oauth) requestTimeout() time.Duration {
+	if o.requestTimeoutOverride > 0 {
+		return o.requestTimeoutOverride
+	}
+	return defaultRequestTimeout
+}
+
+func (o *oauth) retryMaxAttempts() int {
+	if o.retryMaxAttemptsOverride > 0 {
+		return o.retryMaxAttemptsOverride
+	}
+	return defaultRetryMaxAttempts
+}
+
+// rawResponse is one HTTP round trip's outcome, before any endpoint-specific
+// interpretation of status codes or error bodies.
+type rawResponse struct {
+	statusCode int
+	body       []byte
+}
+
+// doRaw POSTs values as application/x-www-form-urlencoded to rawURL via
+// client, retrying 5xx responses, 429 responses and network errors with
+// exponential backoff (honoring Retry-After on 429), making at most
+// retryMaxAttempts attempts in all.
+func (o *oauth) doRaw(ctx context.Context, client *http.Client, rawURL string, values url.Values, basicAuth bool) (*rawResponse, error) {
+	var lastErr error
+
+	// alreadyWaited is set once an attempt sleeps on a 429's Retry-After, so
+	// the next loop iteration doesn't also apply the exponential-backoff
+	// presleep on top of it.
+	alreadyWaited := false
+
+	for attempt := 0; attempt < o.retryMaxAttempts(); attempt++ {
+		if attempt > 0 && !alreadyWaited {
+			if err := sleep(ctx, retryBaseDelay*time.Duration(uint(1)<<uint(attempt-1))); err != nil {
+				return nil, err
+			}
+		}
+		alreadyWaited = false
+
+		resp, retryAfter, retryable, err := o.doRawOnce(ctx, client, rawURL, values, basicAuth)
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr = err
+		if !retryable {
+			return nil, err
+		}
+		if retryAfter > 0 {
+			if err := sleep(ctx, retryAfter); err != nil {
+				return nil, err
+			}
+			alreadyWaited = true
+		}
+	}
+
+	return nil, lastErr
+}
+
+func (o *oauth) doRawOnce(ctx context.Context, client *http.Client, rawURL string, values url.Values, basicAuth bool) (resp *rawResponse, retryAfter time.Duration, retryable bool, err error) {
+	reqCtx, cancel := context.WithTimeout(ctx, o.requestTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, rawURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicAuth {
+		req.SetBasicAuth(o.clientConf.ClientID, o.clientConf.ClientSecret)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, true, err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return nil, parseRetryAfter(res.Header.Get("Retry-After")), true, errTooManyRequests
+	}
+
+	if res.StatusCode >= 500 {
+		return nil, 0, true, fmt.Errorf("oauthclient: server error %d", res.StatusCode)
+	}
+
+	return &rawResponse{statusCode: res.StatusCode, body: body}, 0, false, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// doForm calls a "call"-style endpoint (introspect, users/*, find-user, …)
+// authenticated via o.client's client_credentials transport, converting a
+// 3xx or 4xx status (other than 429) into an sdkcm.AppError. 5xx and 429
+// responses are retried by doRaw and, once attempts run out, come back as a
+// plain error rather than an sdkcm.AppError.
+func (o *oauth) doForm(ctx context.Context, rawURL string, values url.Values) ([]byte, error) {
+	resp, err := o.doRaw(ctx, o.client, rawURL, values, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.statusCode >= 300 {
+		var appErr sdkcm.AppError
+		if err := json.Unmarshal(resp.body, &appErr); err != nil {
+			return nil, err
+		}
+		return nil, appErr
+	}
+
+	return resp.body, nil
+}
+
+// doGrantForm posts a grant request (password, refresh_token,
+// authorization_code, …) to rawURL using HTTP Basic auth from the client's
+// own credentials, independent of o.client's client_credentials transport
+// (which needs a token this call may itself be the one producing). Grant
+// responses carry their own error shape (TokenResponse.Error), so for any
+// status below 500 other than 429 the status code and raw body are returned
+// as-is for the caller to interpret. 5xx and 429 responses are retried by
+// doRaw and, once attempts run out, come back as err instead.
+func (o *oauth) doGrantForm(ctx context.Context, rawURL string, values url.Values) (body []byte, statusCode int, err error) {
+	client := &http.Client{Transport: o.buildTransport(http.DefaultTransport)}
+
+	resp, err := o.doRaw(ctx, client, rawURL, values, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.body, resp.statusCode, nil
+}
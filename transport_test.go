@@ -0,0 +1,138 @@
+/*
+ * @author          Viet Tran <viettranx@gmail.com>
+ * @copyright       2019 Viet Tran <viettranx@gmail.com>
+ * @license         Apache-2.0
+ */
+
+package oauthclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+func TestParseRetryAfterSeconds(t *testing.T) {
+	d := parseRetryAfter("2")
+	if d != 2*time.Second {
+		t.Fatalf("parseRetryAfter(%q) = %v, want %v", "2", d, 2*time.Second)
+	}
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+
+	d := parseRetryAfter(future)
+	if d <= 0 || d > 5*time.Second {
+		t.Fatalf("parseRetryAfter(%q) = %v, want a positive duration <= 5s", future, d)
+	}
+}
+
+func TestParseRetryAfterEmpty(t *testing.T) {
+	if d := parseRetryAfter(""); d != 0 {
+		t.Fatalf("parseRetryAfter(\"\") = %v, want 0", d)
+	}
+}
+
+func TestParseRetryAfterPastDateIsZero(t *testing.T) {
+	past := time.Now().Add(-5 * time.Second).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(past); d != 0 {
+		t.Fatalf("parseRetryAfter(%q) = %v, want 0 for a date already in the past", past, d)
+	}
+}
+
+func newTestClient() *oauth {
+	return New("test", clientcredentials.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+}
+
+func TestDoGrantFormRetriesOn5xxThenSucceeds(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.retryMaxAttemptsOverride = 3
+	o.requestTimeoutOverride = 2 * time.Second
+
+	body, statusCode, err := o.doGrantForm(context.Background(), server.URL, url.Values{})
+	if err != nil {
+		t.Fatalf("doGrantForm returned error: %v", err)
+	}
+	if statusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("doGrantForm = (%q, %d), want (\"ok\", 200)", body, statusCode)
+	}
+	if requests != 3 {
+		t.Fatalf("server saw %d requests, want 3 (2 failures + 1 success)", requests)
+	}
+}
+
+func TestDoGrantFormDoesNotRetryOnClientError(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("bad"))
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.retryMaxAttemptsOverride = 3
+	o.requestTimeoutOverride = 2 * time.Second
+
+	body, statusCode, err := o.doGrantForm(context.Background(), server.URL, url.Values{})
+	if err != nil {
+		t.Fatalf("doGrantForm returned error: %v", err)
+	}
+	if statusCode != http.StatusBadRequest || string(body) != "bad" {
+		t.Fatalf("doGrantForm = (%q, %d), want (\"bad\", 400)", body, statusCode)
+	}
+	if requests != 1 {
+		t.Fatalf("server saw %d requests, want 1 (4xx is not retryable)", requests)
+	}
+}
+
+func TestDoGrantFormHonorsRetryAfterOn429(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	o := newTestClient()
+	o.retryMaxAttemptsOverride = 2
+	o.requestTimeoutOverride = 2 * time.Second
+
+	body, statusCode, err := o.doGrantForm(context.Background(), server.URL, url.Values{})
+	if err != nil {
+		t.Fatalf("doGrantForm returned error: %v", err)
+	}
+	if statusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("doGrantForm = (%q, %d), want (\"ok\", 200)", body, statusCode)
+	}
+	if requests != 2 {
+		t.Fatalf("server saw %d requests, want 2 (1 rate-limited + 1 success)", requests)
+	}
+}